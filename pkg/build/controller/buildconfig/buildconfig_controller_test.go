@@ -3,28 +3,39 @@ package controller
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	ktesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	buildv1 "github.com/openshift/api/build/v1"
+	imagev1 "github.com/openshift/api/image/v1"
 	buildlister "github.com/openshift/client-go/build/listers/build/v1"
+	imagelister "github.com/openshift/client-go/image/listers/image/v1"
 
 	"github.com/openshift/client-go/build/clientset/versioned/fake"
 )
 
 func TestHandleBuildConfig(t *testing.T) {
 	tests := []struct {
-		name              string
-		bc                *buildv1.BuildConfig
-		expectBuild       bool
-		instantiatorError bool
-		expectErr         bool
-		oldTriggers       []tagTriggerID
-		currentTriggers   []tagTriggerID
+		name               string
+		bc                 *buildv1.BuildConfig
+		expectBuild        bool
+		instantiatorError  bool
+		expectErr          bool
+		oldTriggers        []tagTriggerID
+		currentTriggers    []tagTriggerID
+		expectDuplicates   bool
+		denyCrossNamespace bool
+		expectDenyReason   string
+		expectPreservedID  string
+		manualToken        string
+		priorManualTokens  []string
 	}{
 		{
 			name:        "build config with no config change trigger",
@@ -135,6 +146,115 @@ func TestHandleBuildConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "duplicate ict two explicit same tag",
+			bc:   baseBuildConfig(),
+			currentTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					LastTriggeredId: "abcdef0",
+				},
+				{
+					ImageStreamTag:  "test:latest",
+					LastTriggeredId: "abcdef0",
+				},
+			},
+			expectDuplicates: true,
+		},
+		{
+			name: "duplicate ict explicit collides with nil from",
+			bc:   baseBuildConfig(),
+			currentTriggers: []tagTriggerID{
+				{},
+				{
+					// matches the SourceStrategy.From of baseBuildConfig, so
+					// this explicit trigger collides with the nil-from one.
+					ImageStreamTag:  "builderimage:latest",
+					LastTriggeredId: "abcdef0",
+				},
+			},
+			expectDuplicates: true,
+		},
+		{
+			name: "cross namespace same name does not collide",
+			bc:   baseBuildConfig(),
+			currentTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "ns-a",
+					LastTriggeredId: "abcdef0",
+				},
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "ns-b",
+					LastTriggeredId: "ghijkl0",
+				},
+			},
+			expectDuplicates: false,
+		},
+		{
+			name: "cross namespace trigger allowed",
+			bc:   baseBuildConfig(),
+			currentTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "shared",
+					LastTriggeredId: "abcdef0",
+				},
+			},
+		},
+		{
+			name: "cross namespace trigger denied",
+			bc:   baseBuildConfig(),
+			currentTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "shared",
+					LastTriggeredId: "abcdef0",
+				},
+			},
+			denyCrossNamespace: true,
+			expectDenyReason:   crossNamespaceDeniedReason,
+		},
+		{
+			name: "cross namespace trigger denied preserves prior status",
+			bc:   baseBuildConfig(),
+			oldTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "shared",
+					LastTriggeredId: "abcdef0",
+				},
+			},
+			currentTriggers: []tagTriggerID{
+				{
+					ImageStreamTag:  "test:latest",
+					Namespace:       "shared",
+					LastTriggeredId: "ghijkl0",
+				},
+			},
+			denyCrossNamespace: true,
+			expectDenyReason:   crossNamespaceDeniedReason,
+			expectPreservedID:  "abcdef0",
+		},
+		{
+			name:        "manual trigger without annotation -> no build",
+			bc:          buildConfigWithManualTrigger(),
+			expectBuild: false,
+		},
+		{
+			name:        "manual trigger with new annotation token -> build",
+			bc:          buildConfigWithManualTrigger(),
+			manualToken: "ci-run-42",
+			expectBuild: true,
+		},
+		{
+			name:              "manual trigger with repeat annotation token -> no build",
+			bc:                buildConfigWithManualTrigger(),
+			manualToken:       "ci-run-42",
+			priorManualTokens: []string{"ci-run-42"},
+			expectBuild:       false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -176,11 +296,22 @@ func TestHandleBuildConfig(t *testing.T) {
 		if len(tc.currentTriggers) > 0 {
 			tc.bc = buildConfigWithImageChangeTriggers(tc.currentTriggers, tc.bc)
 		}
+		if len(tc.manualToken) > 0 {
+			if tc.bc.Annotations == nil {
+				tc.bc.Annotations = map[string]string{}
+			}
+			tc.bc.Annotations[manualTriggerTokenAnnotation] = tc.manualToken
+		}
+		if len(tc.priorManualTokens) > 0 {
+			tc.bc.Status.ManualTriggerTokens = append([]string{}, tc.priorManualTokens...)
+		}
 		controller := &BuildConfigController{
 			buildLister:       &okBuildLister{},
 			buildConfigGetter: buildClient.BuildV1(),
 			buildGetter:       buildClient.BuildV1(),
 			buildConfigLister: &okBuildConfigGetter{BuildConfig: tc.bc},
+			imageStreamLister: &okImageStreamLister{},
+			sarClient:         &fakeSARClient{allowed: !tc.denyCrossNamespace},
 			recorder:          &record.FakeRecorder{},
 		}
 		err := controller.handleBuildConfig(tc.bc)
@@ -220,8 +351,82 @@ func TestHandleBuildConfig(t *testing.T) {
 				}
 			}
 		}
+		cond := duplicateTriggerCondition(tc.bc)
+		gotDuplicates := cond != nil && cond.Status == corev1.ConditionTrue
+		if gotDuplicates != tc.expectDuplicates {
+			t.Errorf("%s: expected duplicate triggers condition %v, got %v", tc.name, tc.expectDuplicates, gotDuplicates)
+		}
+		if len(tc.expectDenyReason) > 0 {
+			if len(tc.bc.Status.ImageChangeTriggers) == 0 || tc.bc.Status.ImageChangeTriggers[0].Reason != tc.expectDenyReason {
+				t.Errorf("%s: expected ICT status reason %s, got %q", tc.name, tc.expectDenyReason, tc.bc.Status.ImageChangeTriggers[0].Reason)
+			}
+		}
+		if len(tc.expectPreservedID) > 0 {
+			if len(tc.bc.Status.ImageChangeTriggers) == 0 || tc.bc.Status.ImageChangeTriggers[0].LastTriggeredImageID != tc.expectPreservedID {
+				t.Errorf("%s: expected denied trigger to preserve LastTriggeredImageID %s, got %q", tc.name, tc.expectPreservedID, tc.bc.Status.ImageChangeTriggers[0].LastTriggeredImageID)
+			}
+		}
+	}
+
+}
+
+// TestDuplicateImageChangeTriggersStableAcrossResync verifies that a
+// duplicate ImageChangeTrigger stays suppressed across repeated reconciles of
+// an already-statused BuildConfig, not just the first one. A plain resync
+// with no spec change must not let the later duplicate's old-status lookup
+// collide with the earlier, kept trigger's slot and pick up its
+// LastTriggeredImageID/LastTriggerCause.
+func TestDuplicateImageChangeTriggersStableAcrossResync(t *testing.T) {
+	bc := baseBuildConfig()
+	bc = buildConfigWithImageChangeTriggers([]tagTriggerID{
+		{ImageStreamTag: "test:latest", LastTriggeredId: "abcdef0"},
+		{ImageStreamTag: "test:latest", LastTriggeredId: "abcdef0"},
+	}, bc)
+	buildClient := fake.NewSimpleClientset(bc)
+
+	controller := &BuildConfigController{
+		buildLister:       &okBuildLister{},
+		buildConfigGetter: buildClient.BuildV1(),
+		buildGetter:       buildClient.BuildV1(),
+		buildConfigLister: &okBuildConfigGetter{BuildConfig: bc},
+		imageStreamLister: &okImageStreamLister{},
+		sarClient:         &fakeSARClient{allowed: true},
+		recorder:          &record.FakeRecorder{},
+	}
+
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error on first reconcile: %v", err)
+	}
+	if len(bc.Status.ImageChangeTriggers) != 2 {
+		t.Fatalf("expected 2 ICT status entries, got %d", len(bc.Status.ImageChangeTriggers))
+	}
+	if bc.Status.ImageChangeTriggers[1].LastTriggeredImageID != "" {
+		t.Fatalf("expected duplicate trigger suppressed after first reconcile, got LastTriggeredImageID %q", bc.Status.ImageChangeTriggers[1].LastTriggeredImageID)
+	}
+
+	// An ordinary resync with no spec change must not let the duplicate's
+	// old-status lookup collide with entry 0's slot.
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error on second reconcile: %v", err)
+	}
+	if bc.Status.ImageChangeTriggers[1].LastTriggeredImageID != "" {
+		t.Fatalf("expected duplicate trigger still suppressed after second reconcile, got LastTriggeredImageID %q", bc.Status.ImageChangeTriggers[1].LastTriggeredImageID)
+	}
+	if len(bc.Status.ImageChangeTriggers[1].LastTriggerCause) != 0 {
+		t.Fatalf("expected duplicate trigger to carry no trigger cause, got %q", bc.Status.ImageChangeTriggers[1].LastTriggerCause)
 	}
+	if bc.Status.ImageChangeTriggers[0].LastTriggeredImageID != "abcdef0" {
+		t.Fatalf("expected kept trigger to retain LastTriggeredImageID abcdef0, got %q", bc.Status.ImageChangeTriggers[0].LastTriggeredImageID)
+	}
+}
 
+func duplicateTriggerCondition(bc *buildv1.BuildConfig) *buildv1.BuildConfigCondition {
+	for i := range bc.Status.Conditions {
+		if bc.Status.Conditions[i].Type == buildv1.DuplicateImageChangeTriggers {
+			return &bc.Status.Conditions[i]
+		}
+	}
+	return nil
 }
 
 func TestCheckImageChangeTriggerCleared(t *testing.T) {
@@ -388,6 +593,14 @@ func buildConfigWithNonZeroLastVersion() *buildv1.BuildConfig {
 	return bc
 }
 
+func buildConfigWithManualTrigger() *buildv1.BuildConfig {
+	bc := baseBuildConfig()
+	manualTrigger := buildv1.BuildTriggerPolicy{}
+	manualTrigger.Type = buildv1.ManualBuildTriggerType
+	bc.Spec.Triggers = append(bc.Spec.Triggers, manualTrigger)
+	return bc
+}
+
 func buildConfigWithImageChangeTriggers(triggers []tagTriggerID, bc *buildv1.BuildConfig) *buildv1.BuildConfig {
 	if bc == nil {
 		bc = baseBuildConfig()
@@ -399,8 +612,9 @@ func buildConfigWithImageChangeTriggers(triggers []tagTriggerID, bc *buildv1.Bui
 		}
 		if len(trigger.ImageStreamTag) > 0 {
 			imageChangeTrigger.From = &corev1.ObjectReference{
-				Kind: "ImageStreamTag",
-				Name: trigger.ImageStreamTag,
+				Kind:      "ImageStreamTag",
+				Name:      trigger.ImageStreamTag,
+				Namespace: trigger.Namespace,
 			}
 		}
 		bc.Spec.Triggers = append(bc.Spec.Triggers, buildv1.BuildTriggerPolicy{
@@ -419,8 +633,9 @@ func buildConfigWithImageChangeTriggerStatuses(triggers []tagTriggerID, bc *buil
 		}
 		if len(trigger.ImageStreamTag) > 0 {
 			imageChangeTrigger.From = &corev1.ObjectReference{
-				Kind: "ImageStreamTag",
-				Name: trigger.ImageStreamTag,
+				Kind:      "ImageStreamTag",
+				Name:      trigger.ImageStreamTag,
+				Namespace: trigger.Namespace,
 			}
 		}
 		bc.Status.ImageChangeTriggers = append(bc.Status.ImageChangeTriggers, imageChangeTrigger)
@@ -430,6 +645,7 @@ func buildConfigWithImageChangeTriggerStatuses(triggers []tagTriggerID, bc *buil
 
 type tagTriggerID struct {
 	ImageStreamTag  string
+	Namespace       string
 	LastTriggeredId string
 	Paused          bool
 }
@@ -466,3 +682,113 @@ func (okc *okBuildConfigGetter) BuildConfigs(ns string) buildlister.BuildConfigN
 func (okc *okBuildConfigGetter) List(label labels.Selector) ([]*buildv1.BuildConfig, error) {
 	return nil, fmt.Errorf("not implemented")
 }
+
+type okImageStreamLister struct{}
+
+func (okl *okImageStreamLister) List(selector labels.Selector) ([]*imagev1.ImageStream, error) {
+	return nil, nil
+}
+
+func (okl *okImageStreamLister) ImageStreams(ns string) imagelister.ImageStreamNamespaceLister {
+	return okl
+}
+
+func (okl *okImageStreamLister) Get(name string) (*imagev1.ImageStream, error) {
+	return &imagev1.ImageStream{}, nil
+}
+
+type fakeSARClient struct {
+	allowed bool
+}
+
+func (f *fakeSARClient) Create(sar *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+	sar.Status.Allowed = f.allowed
+	return sar, nil
+}
+
+// TestImageChangeTriggerDebounce verifies that Status.ImageChangeTriggers
+// entries are stamped with LastTriggerTime/LastTriggerCause when they adopt a
+// new image, that MinImageChangeInterval suppresses a too-soon re-trigger,
+// and that explicitly clearing a trigger's LastTriggeredImageID also clears
+// its time and cause.
+func TestImageChangeTriggerDebounce(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(start)
+
+	bc := baseBuildConfig()
+	bc = buildConfigWithImageChangeTriggers([]tagTriggerID{{ImageStreamTag: "test:latest", LastTriggeredId: "v1"}}, bc)
+	buildClient := fake.NewSimpleClientset(bc)
+
+	controller := &BuildConfigController{
+		buildLister:            &okBuildLister{},
+		buildConfigGetter:      buildClient.BuildV1(),
+		buildGetter:            buildClient.BuildV1(),
+		buildConfigLister:      &okBuildConfigGetter{BuildConfig: bc},
+		imageStreamLister:      &okImageStreamLister{},
+		sarClient:              &fakeSARClient{allowed: true},
+		recorder:               &record.FakeRecorder{},
+		clock:                  fakeClock,
+		MinImageChangeInterval: time.Minute,
+	}
+
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ict := bc.Status.ImageChangeTriggers[0]
+	if ict.LastTriggeredImageID != "v1" {
+		t.Fatalf("expected LastTriggeredImageID v1, got %s", ict.LastTriggeredImageID)
+	}
+	if !ict.LastTriggerTime.Time.Equal(start) {
+		t.Fatalf("expected LastTriggerTime %v, got %v", start, ict.LastTriggerTime.Time)
+	}
+	if ict.LastTriggerCause != buildv1.ImageChangeTriggerCauseImageChange {
+		t.Fatalf("expected ImageChange cause, got %s", ict.LastTriggerCause)
+	}
+
+	// An image flap 10s later is within the 1m debounce window and must not
+	// be adopted.
+	fakeClock.Step(10 * time.Second)
+	bc.Spec.Triggers[0].ImageChange.LastTriggeredImageID = "v2"
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ict = bc.Status.ImageChangeTriggers[0]
+	if ict.LastTriggeredImageID != "v1" {
+		t.Fatalf("expected debounced LastTriggeredImageID v1, got %s", ict.LastTriggeredImageID)
+	}
+	if !ict.LastTriggerTime.Time.Equal(start) {
+		t.Fatalf("expected LastTriggerTime to stay at %v while debounced, got %v", start, ict.LastTriggerTime.Time)
+	}
+
+	// Once the debounce window has passed, the new image is adopted and
+	// re-stamped.
+	fakeClock.Step(time.Minute)
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ict = bc.Status.ImageChangeTriggers[0]
+	if ict.LastTriggeredImageID != "v2" {
+		t.Fatalf("expected LastTriggeredImageID v2 after debounce window, got %s", ict.LastTriggeredImageID)
+	}
+	if !ict.LastTriggerTime.Time.Equal(fakeClock.Now()) {
+		t.Fatalf("expected LastTriggerTime to advance to %v, got %v", fakeClock.Now(), ict.LastTriggerTime.Time)
+	}
+
+	// Clearing the spec's LastTriggeredImageID clears the observed image,
+	// time and cause together.
+	fakeClock.Step(time.Hour)
+	bc.Spec.Triggers[0].ImageChange.LastTriggeredImageID = ""
+	if err := controller.handleBuildConfig(bc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ict = bc.Status.ImageChangeTriggers[0]
+	if len(ict.LastTriggeredImageID) != 0 {
+		t.Fatalf("expected LastTriggeredImageID to be cleared, got %s", ict.LastTriggeredImageID)
+	}
+	if !ict.LastTriggerTime.IsZero() {
+		t.Fatalf("expected LastTriggerTime to be cleared, got %v", ict.LastTriggerTime.Time)
+	}
+	if len(ict.LastTriggerCause) != 0 {
+		t.Fatalf("expected LastTriggerCause to be cleared, got %s", ict.LastTriggerCause)
+	}
+}